@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// generateNext picks the next rune for the given N-length context, walking
+// down the order ladder (Katz-style backoff) instead of searching for the
+// nearest n-gram by edit distance. It tries the order-N table first; if
+// that context is a dead end or has fewer than minObservations() total
+// observations, it drops the leftmost rune of the context and tries
+// order-(N-1), and so on down to order-1 (the unigram table). The order-1
+// table is non-empty for any trained model, but it is still keyed by
+// context, so it has no entry for a rune that only ever occurred at the
+// very end of the corpus (never itself followed by anything, so never
+// recorded as a context at any order). If the ladder bottoms out with no
+// entry even at order 1, generateNext falls back to globalStats, the
+// unconditional rune-frequency table, which has no notion of context and
+// so can never dead-end.
+func (m *MarkovSeedGenerator) generateNext(seed string) (rune, error) {
+	minObs := float64(m.minObservations())
+	alpha := m.backoffAlpha()
+	skips := 0
+
+	for order := m.N; order >= 1; order-- {
+		key := lastRunes(seed, order)
+		stats := m.Models[order][key]
+		if stats == nil || len(stats.Chars) == 0 {
+			skips++
+			continue
+		}
+
+		// Discount the evidence by how many longer contexts were skipped
+		// to get here, so a distant backoff needs proportionally more
+		// observations to be trusted. The unigram table is always trusted,
+		// since it is the last context-keyed resort.
+		discounted := float64(stats.Total) * math.Pow(alpha, float64(skips))
+		if order == 1 || discounted >= minObs {
+			if skips > 0 {
+				m.log("Backoff: using order-%d table (skipped %d longer contexts) for %q", order, skips, seed)
+			}
+			return m.sampleNext(stats)
+		}
+		skips++
+	}
+
+	if m.globalStats != nil && len(m.globalStats.Chars) > 0 {
+		m.log("Backoff: %q has no context table at any order, using global rune frequencies", seed)
+		return m.sampleNext(m.globalStats)
+	}
+
+	return 0, fmt.Errorf("no valid transitions available at any order")
+}
+
+// buildGlobalStats aggregates unconditional successor-rune frequencies
+// across the whole corpus from the order-N table, which records every
+// trained position's successor rune regardless of context. Train and the
+// model loaders call this once their tables are in place, so generateNext
+// always has a context-free fallback to draw from.
+func (m *MarkovSeedGenerator) buildGlobalStats() {
+	keys := make([]string, 0, len(m.Model))
+	for key := range m.Model {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	global := newNgramStats()
+	for _, key := range keys {
+		stats := m.Model[key]
+		for i, c := range stats.Chars {
+			global.add(c, stats.Counts[i])
+		}
+	}
+	m.globalStats = global
+}
+
+func (m *MarkovSeedGenerator) minObservations() int {
+	if m.MinObservations <= 0 {
+		return 1
+	}
+	return m.MinObservations
+}
+
+func (m *MarkovSeedGenerator) backoffAlpha() float64 {
+	if m.BackoffAlpha <= 0 {
+		return 0.4
+	}
+	return m.BackoffAlpha
+}
+
+// lastRunes returns the last k runes of s, or s itself if it has k or
+// fewer runes.
+func lastRunes(s string, k int) string {
+	r := []rune(s)
+	if k >= len(r) {
+		return s
+	}
+	return string(r[len(r)-k:])
+}
+
+// rebuildLowerOrders derives order-1..N-1 transition tables from the
+// order-N table alone, for models that were loaded from disk rather than
+// trained directly (persistence only stores the top order). Each order-N
+// key contributes its successor counts to every shorter suffix of that
+// key, so Generate can still back off after a load.
+func (m *MarkovSeedGenerator) rebuildLowerOrders() {
+	models := newOrderModels(m.N)
+	models[m.N] = m.Model
+
+	// Iterate keys in sorted order, not map order: map iteration is
+	// randomized per process, and the order in which keys contribute to a
+	// shared lower-order ngramStats determines the slice order sampleNext
+	// draws from. Without sorting, a seeded RNG would pick a different
+	// rune for the same draw on every run once a model has been through
+	// LoadModel/LoadModelBinary.
+	keys := make([]string, 0, len(m.Model))
+	for key := range m.Model {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		stats := m.Model[key]
+		keyRunes := []rune(key)
+		for order := 1; order < m.N; order++ {
+			if order > len(keyRunes) {
+				continue
+			}
+			subKey := string(keyRunes[len(keyRunes)-order:])
+			sub, ok := models[order][subKey]
+			if !ok {
+				sub = newNgramStats()
+				models[order][subKey] = sub
+			}
+			for i, c := range stats.Chars {
+				sub.add(c, stats.Counts[i])
+			}
+		}
+	}
+
+	m.Models = models
+	m.buildGlobalStats()
+}
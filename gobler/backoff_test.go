@@ -0,0 +1,102 @@
+package main
+
+import "testing"
+
+func newGeneratorWithModels(t *testing.T, n int) *MarkovSeedGenerator {
+	t.Helper()
+	m, err := NewMarkovSeedGenerator(n, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// TestGenerateNextDeadEndBacksOffToLowerOrder checks that a context with no
+// entry at all at order N falls through to the next order down rather than
+// erroring immediately.
+func TestGenerateNextDeadEndBacksOffToLowerOrder(t *testing.T) {
+	m := newGeneratorWithModels(t, 3)
+
+	m.Models[3] = map[string]*ngramStats{} // "xzz" is a dead end at order 3
+
+	order2 := newNgramStats()
+	order2.add('!', 3) // enough observations to survive the alpha discount for one skip
+	m.Models[2] = map[string]*ngramStats{"zz": order2}
+
+	r, err := m.generateNext("xzz")
+	if err != nil {
+		t.Fatalf("generateNext: %v", err)
+	}
+	if r != '!' {
+		t.Fatalf("expected backoff to the order-2 table to produce '!', got %q", r)
+	}
+}
+
+// TestGenerateNextLowObservationsBacksOff checks that a context which exists
+// but falls below MinObservations (after alpha discounting) is treated as
+// untrustworthy and backed off, even though it has an entry.
+func TestGenerateNextLowObservationsBacksOff(t *testing.T) {
+	m := newGeneratorWithModels(t, 2)
+	m.MinObservations = 5
+
+	order2 := newNgramStats()
+	order2.observe('a') // total 1, well below MinObservations
+	m.Models[2] = map[string]*ngramStats{"xy": order2}
+
+	order1 := newNgramStats()
+	order1.observe('b')
+	m.Models[1] = map[string]*ngramStats{"y": order1}
+
+	r, err := m.generateNext("xy")
+	if err != nil {
+		t.Fatalf("generateNext: %v", err)
+	}
+	if r != 'b' {
+		t.Fatalf("expected backoff to the order-1 table to produce 'b', got %q", r)
+	}
+}
+
+// TestGenerateNextFallsBackToGlobalStats is the guaranteed-fallback case:
+// even the order-1 table has no entry for this context (it was never
+// itself observed as a context), so generateNext must draw from the
+// unconditional globalStats table instead of erroring.
+func TestGenerateNextFallsBackToGlobalStats(t *testing.T) {
+	m := newGeneratorWithModels(t, 2)
+	m.Models[2] = map[string]*ngramStats{}
+	m.Models[1] = map[string]*ngramStats{}
+
+	global := newNgramStats()
+	global.observe('#')
+	m.globalStats = global
+
+	r, err := m.generateNext("xy")
+	if err != nil {
+		t.Fatalf("generateNext: %v", err)
+	}
+	if r != '#' {
+		t.Fatalf("expected fallback to globalStats to produce '#', got %q", r)
+	}
+}
+
+// TestGenerateNextDeadEndTrailingRune reproduces the reported bug: a corpus
+// whose trailing rune is unique (never itself followed by anything during
+// training, so it was never recorded as a context at any order) must not
+// dead-end generation once that rune becomes part of the live seed.
+func TestGenerateNextDeadEndTrailingRune(t *testing.T) {
+	m := newGeneratorWithModels(t, 3)
+	corpus := "the fox runs fast while the dog watches quietly from the porch~"
+	if err := m.Train(corpus); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, order := range []int{1, 2, 3} {
+		key := lastRunes("ch~", order)
+		if stats := m.Models[order][key]; stats != nil && len(stats.Chars) > 0 {
+			t.Fatalf("expected order-%d context %q to be absent (trailing rune never a context), got %v", order, key, stats.Chars)
+		}
+	}
+
+	if _, err := m.generateNext("ch~"); err != nil {
+		t.Fatalf("generateNext on a context absent at every order: %v", err)
+	}
+}
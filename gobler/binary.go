@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/golang/snappy"
+)
+
+// binaryMagic identifies the compact binary model container and its
+// current format version (the trailing 4 bytes). LoadModel sniffs this
+// prefix to tell binary models apart from JSON ones.
+const binaryMagic = "MRKV\x00\x00\x00\x01"
+
+// SaveModelBinary writes m in a compact, snappy-compressed binary format:
+// an 8-byte magic, a varint header (N, rune-count, n-gram-count), an
+// interned rune table, then per-n-gram records of delta-encoded successor
+// rune indices with varint frequency counts. This is substantially smaller
+// and faster to parse than the pretty-printed JSON format.
+func (m *MarkovSeedGenerator) SaveModelBinary(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create model file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(binaryMagic); err != nil {
+		return fmt.Errorf("failed to write model header: %w", err)
+	}
+
+	runes, runeIndex := internRunes(m.Model)
+
+	keys := make([]string, 0, len(m.Model))
+	for key := range m.Model {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(m.N))
+	writeUvarint(&buf, uint64(len(runes)))
+	writeUvarint(&buf, uint64(len(keys)))
+
+	for _, r := range runes {
+		writeVarint(&buf, int64(r))
+	}
+
+	for _, key := range keys {
+		for _, r := range []rune(key) {
+			writeUvarint(&buf, uint64(runeIndex[r]))
+		}
+
+		stats := m.Model[key]
+		writeUvarint(&buf, uint64(len(stats.Chars)))
+		prev := 0
+		for i, c := range stats.Chars {
+			idx := runeIndex[c]
+			writeVarint(&buf, int64(idx-prev))
+			prev = idx
+			writeUvarint(&buf, uint64(stats.Counts[i]))
+		}
+	}
+
+	sw := snappy.NewBufferedWriter(file)
+	if _, err := sw.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write compressed model: %w", err)
+	}
+	if err := sw.Close(); err != nil {
+		return fmt.Errorf("failed to flush compressed model: %w", err)
+	}
+
+	m.log("Binary model saved to %s", filename)
+	return nil
+}
+
+// LoadModelBinary reads a model previously written by SaveModelBinary.
+func (m *MarkovSeedGenerator) LoadModelBinary(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open model file: %w", err)
+	}
+	defer file.Close()
+
+	return m.loadBinaryFrom(file, filename)
+}
+
+// loadBinaryFrom parses the binary container format from r, starting at
+// the magic prefix. It backs both LoadModelBinary and LoadModel's format
+// auto-detection.
+func (m *MarkovSeedGenerator) loadBinaryFrom(r io.Reader, filename string) error {
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return fmt.Errorf("failed to read model header: %w", err)
+	}
+	if string(magic) != binaryMagic {
+		return fmt.Errorf("%s: not a markov binary model file", filename)
+	}
+
+	br := bufio.NewReader(snappy.NewReader(r))
+
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("failed to read model n: %w", err)
+	}
+	runeCount, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("failed to read model rune table size: %w", err)
+	}
+	ngramCount, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("failed to read model n-gram count: %w", err)
+	}
+
+	runes := make([]rune, runeCount)
+	for i := range runes {
+		v, err := binary.ReadVarint(br)
+		if err != nil {
+			return fmt.Errorf("failed to read rune table: %w", err)
+		}
+		runes[i] = rune(v)
+	}
+
+	m.N = int(n)
+	m.Model = make(map[string]*ngramStats, ngramCount)
+
+	for g := uint64(0); g < ngramCount; g++ {
+		keyRunes := make([]rune, m.N)
+		for i := range keyRunes {
+			idx, err := binary.ReadUvarint(br)
+			if err != nil {
+				return fmt.Errorf("failed to read n-gram key: %w", err)
+			}
+			keyRunes[i] = runes[idx]
+		}
+
+		successorCount, err := binary.ReadUvarint(br)
+		if err != nil {
+			return fmt.Errorf("failed to read successor count: %w", err)
+		}
+
+		stats := &ngramStats{
+			Chars:  make([]rune, successorCount),
+			Counts: make([]uint32, successorCount),
+		}
+		prev := 0
+		for i := uint64(0); i < successorCount; i++ {
+			delta, err := binary.ReadVarint(br)
+			if err != nil {
+				return fmt.Errorf("failed to read successor rune: %w", err)
+			}
+			idx := prev + int(delta)
+			prev = idx
+			stats.Chars[i] = runes[idx]
+
+			count, err := binary.ReadUvarint(br)
+			if err != nil {
+				return fmt.Errorf("failed to read successor count: %w", err)
+			}
+			stats.Counts[i] = uint32(count)
+			stats.Total += uint32(count)
+		}
+
+		m.Model[string(keyRunes)] = stats
+	}
+
+	m.rebuildLowerOrders()
+	m.log("Binary model loaded from %s with %d n-grams", filename, len(m.Model))
+	return nil
+}
+
+// internRunes collects every distinct rune appearing in model keys and
+// successor tables into a stable, sorted table, along with the index each
+// rune was assigned.
+func internRunes(model map[string]*ngramStats) ([]rune, map[rune]int) {
+	seen := make(map[rune]bool)
+	for key, stats := range model {
+		for _, r := range key {
+			seen[r] = true
+		}
+		for _, r := range stats.Chars {
+			seen[r] = true
+		}
+	}
+
+	runes := make([]rune, 0, len(seen))
+	for r := range seen {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	index := make(map[rune]int, len(runes))
+	for i, r := range runes {
+		index[r] = i
+	}
+	return runes, index
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+func writeVarint(buf *bytes.Buffer, v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+// runConvertCommand implements `markov convert <in.json> <out.bin>`,
+// loading a JSON (or already-binary) model and rewriting it in the
+// compact binary format, printing the resulting size difference.
+func runConvertCommand(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: markov convert <model.json> <model.bin>")
+	}
+	src, dst := args[0], args[1]
+
+	m := &MarkovSeedGenerator{Model: make(map[string]*ngramStats)}
+	if err := m.LoadModel(src); err != nil {
+		return fmt.Errorf("failed to load %s: %w", src, err)
+	}
+	if err := m.SaveModelBinary(dst); err != nil {
+		return fmt.Errorf("failed to save %s: %w", dst, err)
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", dst, err)
+	}
+
+	fmt.Printf("Converted %s (%d bytes) -> %s (%d bytes), %.1f%% of original size\n",
+		src, srcInfo.Size(), dst, dstInfo.Size(),
+		float64(dstInfo.Size())/float64(srcInfo.Size())*100)
+	return nil
+}
@@ -1,44 +1,118 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"math"
 	"math/big"
 	"os"
+	"sort"
 	"strings"
 	"unicode/utf8"
 )
 
 type MarkovSeedGenerator struct {
 	N           int
-	Model       map[string][]rune
+	Model       map[string]*ngramStats
 	Text        string
 	Verbose     bool
 	logMessages []string
+
+	// Temperature rescales successor weights as count^(1/T) before sampling.
+	// T < 1 sharpens the distribution toward the most frequent successors,
+	// T > 1 flattens it. Zero or 1 disables rescaling.
+	Temperature float64
+	// TopK restricts sampling to the K most frequent successors. Zero disables it.
+	TopK int
+	// TopP performs nucleus sampling: only the smallest prefix of successors
+	// (ordered by weight, descending) whose cumulative share exceeds P is
+	// considered. Zero or values >= 1 disable it.
+	TopP float64
+
+	// Models holds the transition table for every order from 1 up to N, so
+	// Generate can back off to a shorter context instead of dead-ending.
+	// Models[N] is always the same map as Model.
+	Models []map[string]*ngramStats
+	// MinObservations is the minimum total observation count a context's
+	// successor table must have before Generate trusts it; contexts with
+	// fewer are treated as dead ends and backed off to a shorter order.
+	// Zero uses the default of 1.
+	MinObservations int
+	// BackoffAlpha discounts a backed-off order's observation count by
+	// BackoffAlpha^skips, where skips is the number of longer contexts that
+	// were passed over, so distant fallbacks need more evidence to be
+	// trusted. Zero uses the default of 0.4.
+	BackoffAlpha float64
+
+	// RNG is the source of randomness for Generate. Nil defaults to
+	// crypto/rand; NewMarkovSeedGeneratorWithSeed installs a deterministic
+	// one instead.
+	RNG RNG
+
+	// globalStats holds unconditional successor-rune frequencies across the
+	// whole corpus, used by generateNext as the last-resort fallback below
+	// order 1. Built by buildGlobalStats after training or loading.
+	globalStats *ngramStats
+}
+
+// ngramStats holds the weighted frequency table for a single n-gram key:
+// each observed successor rune is stored once alongside how many times it
+// was seen, instead of once per occurrence.
+type ngramStats struct {
+	Chars  []rune
+	Counts []uint32
+	Total  uint32
+}
+
+func newNgramStats() *ngramStats {
+	return &ngramStats{}
+}
+
+func (s *ngramStats) observe(r rune) {
+	s.add(r, 1)
+}
+
+// add increments r's count by count, appending a new entry if r hasn't
+// been observed before. It underlies observe and the lower-order rollups
+// built by rebuildLowerOrders.
+func (s *ngramStats) add(r rune, count uint32) {
+	for i, c := range s.Chars {
+		if c == r {
+			s.Counts[i] += count
+			s.Total += count
+			return
+		}
+	}
+	s.Chars = append(s.Chars, r)
+	s.Counts = append(s.Counts, count)
+	s.Total += count
 }
 
 type ModelStats struct {
-	NGrams          int
+	NGrams           int
 	TotalTransitions int
 	AvgTransitions   float64
 	MaxTransitions   int
 	MinTransitions   int
-	DeadEnds        int
+	DeadEnds         int
 }
 
 func NewMarkovSeedGenerator(n int, verbose bool) (*MarkovSeedGenerator, error) {
 	if n <= 0 {
 		return nil, fmt.Errorf("n must be positive")
 	}
+	models := newOrderModels(n)
 	return &MarkovSeedGenerator{
 		N:           n,
-		Model:       make(map[string][]rune),
+		Model:       models[n],
+		Models:      models,
 		Verbose:     verbose,
 		logMessages: make([]string, 0),
+		RNG:         cryptoRNG{},
 	}, nil
 }
 
@@ -78,33 +152,30 @@ func (m *MarkovSeedGenerator) ClearLogs() {
 	m.logMessages = m.logMessages[:0]
 }
 
+// Train trains the model on an in-memory string. It delegates to
+// TrainFromReader so both paths share one implementation; TrainFromFile and
+// NewTrainer's Trainer are the bounded-memory equivalents for large corpora.
 func (m *MarkovSeedGenerator) Train(text string) error {
-	// Sanitize input - remove control characters
 	text = sanitizeText(text)
-	
-	runes := []rune(text)
-	if len(runes) <= m.N {
-		return fmt.Errorf("text length %d must be greater than n %d", len(runes), m.N)
+	if err := m.TrainFromReader(strings.NewReader(text)); err != nil {
+		return err
 	}
-
 	m.Text = text
-	limit := len(runes) - m.N
+	return nil
+}
 
-	for i := 0; i < limit; i++ {
-		end := i + m.N
-		if end >= len(runes) {
-			break
-		}
-		key := string(runes[i:end])
-		nextChar := runes[end]
-		
-		m.Model[key] = append(m.Model[key], nextChar)
+// newOrderModels allocates an empty transition table for every order from
+// 1 up to n. Index 0 is left nil; orders are 1-indexed.
+func newOrderModels(n int) []map[string]*ngramStats {
+	models := make([]map[string]*ngramStats, n+1)
+	for order := 1; order <= n; order++ {
+		models[order] = make(map[string]*ngramStats)
 	}
-
-	m.log("Trained model with %d n-grams", len(m.Model))
-	return nil
+	return models
 }
 
+// TrainFromFile trains the model by streaming filename's contents through
+// TrainFromReader, so files far larger than available RAM can be used.
 func (m *MarkovSeedGenerator) TrainFromFile(filename string) error {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -113,52 +184,20 @@ func (m *MarkovSeedGenerator) TrainFromFile(filename string) error {
 	defer file.Close()
 
 	m.log("Training from file: %s", filename)
+	return m.TrainFromReader(file)
+}
 
-	// Get file size for progress reporting
-	info, err := file.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get file info: %w", err)
-	}
-	fileSize := info.Size()
-
-	buffer := make([]byte, 8192) // 8KB chunks
-	var textBuilder strings.Builder
-	processedBytes := int64(0)
-
-	for {
-		n, err := file.Read(buffer)
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("error reading file: %w", err)
-		}
-
-		if n == 0 {
-			break
-		}
-
-		// Convert to string and sanitize
-		chunk := sanitizeText(string(buffer[:n]))
-		textBuilder.WriteString(chunk)
-		processedBytes += int64(n)
-
-		// Log progress for large files
-		if m.Verbose && fileSize > 0 {
-			percent := float64(processedBytes) / float64(fileSize) * 100
-			m.log("Processed %d/%d bytes (%.1f%%)", processedBytes, fileSize, percent)
-		}
-
-		if err == io.EOF {
-			break
-		}
-	}
-
-	return m.Train(textBuilder.String())
+// isSanitizeableRune reports whether r should be kept by sanitizeText and
+// TrainFromReader: printable characters plus newline and tab, with other
+// control characters (0x00-0x1F, 0x7F) dropped.
+func isSanitizeableRune(r rune) bool {
+	return (r >= 32 && r != 127) || r == '\n' || r == '\t'
 }
 
 func sanitizeText(text string) string {
-	// Remove control characters (0x00-0x1F, 0x7F)
 	var result strings.Builder
 	for _, r := range text {
-		if r >= 32 && r != 127 || r == '\n' || r == '\t' {
+		if isSanitizeableRune(r) {
 			result.WriteRune(r)
 		}
 	}
@@ -173,11 +212,13 @@ func (m *MarkovSeedGenerator) Generate(length int, startWith ...string) (string,
 		return "", fmt.Errorf("length %d must be at least n %d", length, m.N)
 	}
 
-	// Get all possible keys
+	// Get all possible keys, sorted so a seeded RNG picks the same starting
+	// n-gram on every run regardless of Go's randomized map iteration order.
 	keys := make([]string, 0, len(m.Model))
 	for k := range m.Model {
 		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
 	// Determine starting seed
 	var seed string
@@ -187,44 +228,21 @@ func (m *MarkovSeedGenerator) Generate(length int, startWith ...string) (string,
 			m.log("Starting generation with: %q", seed)
 		} else {
 			m.log("Warning: Starting n-gram %q not found, using random", startWith[0])
-			seed = keys[secureRandIntn(len(keys))]
+			seed = keys[m.rng().Intn(len(keys))]
 		}
 	} else {
-		seed = keys[secureRandIntn(len(keys))]
+		seed = keys[m.rng().Intn(len(keys))]
 	}
 
 	output := []rune(seed)
 
 	for len(output) < length {
-		nextChars := m.Model[seed]
-		if len(nextChars) == 0 {
-			// Enhanced fallback: try to find similar n-gram
-			similar := m.findSimilarNgram(seed)
-			if similar != "" {
-				m.log("Fallback: using similar n-gram %q for %q", similar, seed)
-				nextChars = m.Model[similar]
-			} else {
-				// Ultimate fallback: random character from text
-				runes := []rune(m.Text)
-				if len(runes) == 0 {
-					return "", fmt.Errorf("no text available for fallback")
-				}
-				nextChar := runes[secureRandIntn(len(runes))]
-				output = append(output, nextChar)
-				if len(seed) > 0 {
-					seed = string([]rune(seed)[1:]) + string(nextChar)
-				}
-				continue
-			}
-		}
-
-		if len(nextChars) == 0 {
-			return "", fmt.Errorf("no valid transitions available")
+		nextChar, err := m.generateNext(seed)
+		if err != nil {
+			return "", err
 		}
-
-		nextChar := nextChars[secureRandIntn(len(nextChars))]
 		output = append(output, nextChar)
-		
+
 		// Update seed: remove first character, add new character
 		seedRunes := []rune(seed)
 		seed = string(seedRunes[1:]) + string(nextChar)
@@ -233,69 +251,99 @@ func (m *MarkovSeedGenerator) Generate(length int, startWith ...string) (string,
 	return string(output[:length]), nil
 }
 
-func (m *MarkovSeedGenerator) findSimilarNgram(target string) string {
-	bestMatch := ""
-	bestDistance := -1
-	targetRunes := []rune(target)
-
-	for key := range m.Model {
-		keyRunes := []rune(key)
-		distance := levenshteinDistance(targetRunes, keyRunes)
-		if bestDistance == -1 || distance < bestDistance {
-			bestDistance = distance
-			bestMatch = key
-		}
-		// Early exit for perfect or near-perfect match
-		if bestDistance <= 1 {
-			break
-		}
+// sampleNext draws a successor rune from stats' weighted frequency table,
+// honoring Temperature, TopK and TopP if they are set.
+func (m *MarkovSeedGenerator) sampleNext(stats *ngramStats) (rune, error) {
+	if len(stats.Chars) == 0 {
+		return 0, fmt.Errorf("no valid transitions available")
 	}
 
-	return bestMatch
-}
+	weights := m.adjustWeights(stats.Counts)
+	indices := topKIndices(weights, m.TopK)
+	indices = topPIndices(weights, indices, m.TopP)
 
-func levenshteinDistance(a, b []rune) int {
-	if len(a) == 0 {
-		return len(b)
+	total := 0
+	for _, idx := range indices {
+		total += weights[idx]
 	}
-	if len(b) == 0 {
-		return len(a)
+	if total <= 0 {
+		return stats.Chars[indices[0]], nil
 	}
 
-	matrix := make([][]int, len(a)+1)
-	for i := range matrix {
-		matrix[i] = make([]int, len(b)+1)
-		matrix[i][0] = i
+	pick := m.rng().Intn(total)
+	cumulative := 0
+	for _, idx := range indices {
+		cumulative += weights[idx]
+		if pick < cumulative {
+			return stats.Chars[idx], nil
+		}
 	}
-	for j := range matrix[0] {
-		matrix[0][j] = j
+	return stats.Chars[indices[len(indices)-1]], nil
+}
+
+// adjustWeights rescales raw successor counts by Temperature, if set, and
+// returns them as integer weights suitable for cumulative-distribution
+// sampling.
+func (m *MarkovSeedGenerator) adjustWeights(counts []uint32) []int {
+	weights := make([]int, len(counts))
+	if m.Temperature <= 0 || m.Temperature == 1.0 {
+		for i, c := range counts {
+			weights[i] = int(c)
+		}
+		return weights
 	}
 
-	for i := 1; i <= len(a); i++ {
-		for j := 1; j <= len(b); j++ {
-			cost := 1
-			if a[i-1] == b[j-1] {
-				cost = 0
-			}
-			matrix[i][j] = min(
-				matrix[i-1][j]+1,      // deletion
-				matrix[i][j-1]+1,      // insertion
-				matrix[i-1][j-1]+cost, // substitution
-			)
+	for i, c := range counts {
+		scaled := math.Pow(float64(c), 1.0/m.Temperature)
+		w := int(math.Round(scaled * 1000))
+		if w < 1 {
+			w = 1
 		}
+		weights[i] = w
 	}
+	return weights
+}
 
-	return matrix[len(a)][len(b)]
+// topKIndices returns the indices of weights sorted by descending weight,
+// truncated to the k highest entries. k <= 0 disables truncation.
+func topKIndices(weights []int, k int) []int {
+	indices := make([]int, len(weights))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(a, b int) bool {
+		return weights[indices[a]] > weights[indices[b]]
+	})
+	if k > 0 && k < len(indices) {
+		indices = indices[:k]
+	}
+	return indices
 }
 
-func min(values ...int) int {
-	minVal := values[0]
-	for _, v := range values[1:] {
-		if v < minVal {
-			minVal = v
+// topPIndices trims indices (already sorted by descending weight) down to
+// the smallest prefix whose cumulative share of the total weight exceeds p.
+// p <= 0 or p >= 1 disables the trim.
+func topPIndices(weights []int, indices []int, p float64) []int {
+	if p <= 0 || p >= 1.0 {
+		return indices
+	}
+
+	total := 0
+	for _, idx := range indices {
+		total += weights[idx]
+	}
+	if total == 0 {
+		return indices
+	}
+
+	cumulative := 0
+	for i, idx := range indices {
+		cumulative += weights[idx]
+		if float64(cumulative)/float64(total) >= p {
+			return indices[:i+1]
 		}
 	}
-	return minVal
+	return indices
 }
 
 func (m *MarkovSeedGenerator) ValidateModel() ModelStats {
@@ -303,8 +351,8 @@ func (m *MarkovSeedGenerator) ValidateModel() ModelStats {
 		MinTransitions: -1,
 	}
 
-	for _, transitions := range m.Model {
-		count := len(transitions)
+	for _, data := range m.Model {
+		count := int(data.Total)
 		stats.NGrams++
 		stats.TotalTransitions += count
 
@@ -326,6 +374,22 @@ func (m *MarkovSeedGenerator) ValidateModel() ModelStats {
 	return stats
 }
 
+// modelFileVersion is the current on-disk JSON schema version written by
+// SaveModel. LoadModel also accepts the unversioned legacy schema (a bare
+// map[string][]rune), reconstructing frequency counts from the repeated runes.
+const modelFileVersion = 2
+
+type modelFile struct {
+	Version int                    `json:"version"`
+	N       int                    `json:"n"`
+	Model   map[string]ngramRecord `json:"model"`
+}
+
+type ngramRecord struct {
+	Chars  []rune   `json:"chars"`
+	Counts []uint32 `json:"counts"`
+}
+
 func (m *MarkovSeedGenerator) SaveModel(filename string) error {
 	file, err := os.Create(filename)
 	if err != nil {
@@ -333,9 +397,18 @@ func (m *MarkovSeedGenerator) SaveModel(filename string) error {
 	}
 	defer file.Close()
 
+	mf := modelFile{
+		Version: modelFileVersion,
+		N:       m.N,
+		Model:   make(map[string]ngramRecord, len(m.Model)),
+	}
+	for key, stats := range m.Model {
+		mf.Model[key] = ngramRecord{Chars: stats.Chars, Counts: stats.Counts}
+	}
+
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(m.Model); err != nil {
+	if err := encoder.Encode(mf); err != nil {
 		return fmt.Errorf("failed to encode model: %w", err)
 	}
 
@@ -344,22 +417,63 @@ func (m *MarkovSeedGenerator) SaveModel(filename string) error {
 }
 
 func (m *MarkovSeedGenerator) LoadModel(filename string) error {
-	file, err := os.Open(filename)
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		return fmt.Errorf("failed to open model file: %w", err)
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&m.Model); err != nil {
-		return fmt.Errorf("failed to decode model: %w", err)
+	// Binary models are sniffed by magic prefix so callers can point either
+	// LoadModel or LoadModelBinary at either format.
+	if len(data) >= len(binaryMagic) && string(data[:len(binaryMagic)]) == binaryMagic {
+		return m.loadBinaryFrom(bytes.NewReader(data), filename)
 	}
 
-	m.log("Model loaded from %s with %d n-grams", filename, len(m.Model))
+	var mf modelFile
+	if err := json.Unmarshal(data, &mf); err == nil && mf.Version > 0 {
+		m.N = mf.N
+		m.Model = make(map[string]*ngramStats, len(mf.Model))
+		for key, rec := range mf.Model {
+			stats := &ngramStats{Chars: rec.Chars, Counts: rec.Counts}
+			for _, c := range rec.Counts {
+				stats.Total += c
+			}
+			m.Model[key] = stats
+		}
+		m.rebuildLowerOrders()
+		m.log("Model loaded from %s (v%d) with %d n-grams", filename, mf.Version, len(m.Model))
+		return nil
+	}
+
+	// Fall back to the unversioned legacy schema: map[string][]rune, one
+	// entry per observed occurrence rather than a frequency count.
+	var legacy map[string][]rune
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return fmt.Errorf("failed to decode model: %w", err)
+	}
+	m.Model = make(map[string]*ngramStats, len(legacy))
+	for key, runes := range legacy {
+		if m.N == 0 {
+			m.N = utf8.RuneCountInString(key)
+		}
+		stats := newNgramStats()
+		for _, r := range runes {
+			stats.observe(r)
+		}
+		m.Model[key] = stats
+	}
+	m.rebuildLowerOrders()
+	m.log("Model loaded from %s (legacy format) with %d n-grams", filename, len(m.Model))
 	return nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "convert" {
+		if err := runConvertCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Robust training text with sufficient length
 	const trainingText = `ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!@#$%^&*()_+-=[]{}|;:,.<>/?` +
 		`The quick brown fox jumps over the lazy dog. Pack my box with five dozen liquor jugs.`
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	mrand "math/rand/v2"
+)
+
+// RNG is the source of randomness Generate draws from. The zero-value
+// MarkovSeedGenerator uses a crypto/rand-backed implementation; seeding
+// with NewMarkovSeedGeneratorWithSeed swaps in a deterministic one so
+// generation can be reproduced and tested without mocking.
+type RNG interface {
+	Intn(n int) int
+}
+
+// cryptoRNG is the default RNG, backed by crypto/rand.
+type cryptoRNG struct{}
+
+func (cryptoRNG) Intn(n int) int {
+	return secureRandIntn(n)
+}
+
+// seededRNG is a deterministic RNG backed by a ChaCha8 stream, for
+// reproducible generation and golden-output tests.
+type seededRNG struct {
+	r *mrand.Rand
+}
+
+func (s seededRNG) Intn(n int) int {
+	return s.r.IntN(n)
+}
+
+// newSeededRNG builds a deterministic RNG from a uint64 seed by expanding
+// it to the 32-byte key math/rand/v2's ChaCha8 source requires.
+func newSeededRNG(seed uint64) RNG {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], seed)
+	return seededRNG{r: mrand.New(mrand.NewChaCha8(sha256.Sum256(buf[:])))}
+}
+
+// NewMarkovSeedGeneratorWithSeed is identical to NewMarkovSeedGenerator
+// except Generate draws from a deterministic PRNG seeded from seed instead
+// of crypto/rand. The same (model, seed) pair always produces the same
+// output, which is the reproducible "seed phrase" the package name implies.
+func NewMarkovSeedGeneratorWithSeed(n int, seed uint64, verbose bool) (*MarkovSeedGenerator, error) {
+	m, err := NewMarkovSeedGenerator(n, verbose)
+	if err != nil {
+		return nil, err
+	}
+	m.RNG = newSeededRNG(seed)
+	return m, nil
+}
+
+// rng returns m.RNG, defaulting to the crypto/rand-backed implementation
+// for generators not constructed through NewMarkovSeedGenerator.
+func (m *MarkovSeedGenerator) rng() RNG {
+	if m.RNG == nil {
+		m.RNG = cryptoRNG{}
+	}
+	return m.RNG
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+const goldenCorpus = "the quick brown fox jumps over the lazy dog. the quick brown fox runs away swiftly. the lazy dog sleeps all day long while the quick fox watches silently from afar."
+
+// generateWithSeed trains a fresh model, round-trips it through
+// SaveModel/LoadModel, and generates from the reloaded model with a fixed
+// seed. It is the reproducible "seed phrase" path NewMarkovSeedGeneratorWithSeed
+// exists for: re-deriving the same output from a stored (model file, seed)
+// pair, not just from a generator that never left memory.
+func generateWithSeed(t *testing.T, seed uint64) string {
+	t.Helper()
+
+	m, err := NewMarkovSeedGeneratorWithSeed(4, seed, false)
+	if err != nil {
+		t.Fatalf("NewMarkovSeedGeneratorWithSeed: %v", err)
+	}
+	if err := m.Train(goldenCorpus); err != nil {
+		t.Fatalf("Train: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "model.json")
+	if err := m.SaveModel(path); err != nil {
+		t.Fatalf("SaveModel: %v", err)
+	}
+
+	reloaded, err := NewMarkovSeedGeneratorWithSeed(4, seed, false)
+	if err != nil {
+		t.Fatalf("NewMarkovSeedGeneratorWithSeed: %v", err)
+	}
+	if err := reloaded.LoadModel(path); err != nil {
+		t.Fatalf("LoadModel: %v", err)
+	}
+
+	out, err := reloaded.Generate(100, "the ")
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	return out
+}
+
+// TestSeededGenerationReproducibleAcrossLoad is the golden-output test the
+// seeded-RNG feature is for: the same (model, seed) pair must produce the
+// same text every time, including after the model has been through a
+// SaveModel/LoadModel round trip rather than generated straight after
+// Train.
+func TestSeededGenerationReproducibleAcrossLoad(t *testing.T) {
+	want := generateWithSeed(t, 777)
+
+	for i := 0; i < 2; i++ {
+		got := generateWithSeed(t, 777)
+		if got != want {
+			t.Fatalf("run %d: output changed across save/load with the same seed\nwant: %q\ngot:  %q", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+// fixedRNG always returns the same value, so tests can assert exactly
+// which index sampleNext's cumulative search lands on.
+type fixedRNG struct{ n int }
+
+func (f fixedRNG) Intn(n int) int {
+	if f.n >= n {
+		return n - 1
+	}
+	return f.n
+}
+
+func TestAdjustWeightsTemperature(t *testing.T) {
+	m, err := NewMarkovSeedGenerator(2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := []uint32{1, 4}
+
+	m.Temperature = 0
+	if w := m.adjustWeights(counts); w[0] != 1 || w[1] != 4 {
+		t.Fatalf("Temperature 0 should pass counts through unchanged, got %v", w)
+	}
+
+	m.Temperature = 0.5
+	w := m.adjustWeights(counts)
+	if w[1] <= w[0]*4 {
+		t.Fatalf("Temperature < 1 should sharpen toward the frequent successor, got %v", w)
+	}
+}
+
+func TestTopKIndices(t *testing.T) {
+	weights := []int{5, 1, 9, 3}
+	indices := topKIndices(weights, 2)
+	if len(indices) != 2 || weights[indices[0]] != 9 || weights[indices[1]] != 5 {
+		t.Fatalf("expected the two highest-weighted indices in descending order, got %v", indices)
+	}
+
+	if all := topKIndices(weights, 0); len(all) != len(weights) {
+		t.Fatalf("TopK 0 should disable truncation, got %v", all)
+	}
+}
+
+func TestTopPIndices(t *testing.T) {
+	// Weights already sorted descending, as topKIndices would leave them.
+	weights := []int{70, 20, 10}
+	indices := []int{0, 1, 2}
+
+	trimmed := topPIndices(weights, indices, 0.8)
+	if len(trimmed) != 2 {
+		t.Fatalf("expected the smallest prefix covering 80%% of mass (70+20=90%%), got %v", trimmed)
+	}
+
+	if all := topPIndices(weights, indices, 0); len(all) != len(indices) {
+		t.Fatalf("TopP 0 should disable the trim, got %v", all)
+	}
+}
+
+func TestSampleNextRespectsTopK(t *testing.T) {
+	m, err := NewMarkovSeedGenerator(2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.TopK = 1
+
+	stats := newNgramStats()
+	stats.add('a', 1)
+	stats.add('b', 9) // far more frequent, should be the only candidate once TopK=1
+
+	m.RNG = fixedRNG{n: 0}
+	r, err := m.sampleNext(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != 'b' {
+		t.Fatalf("TopK=1 should restrict sampling to the most frequent successor 'b', got %q", r)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// slidingWindow holds the last n runes seen while streaming, without
+// reallocating on every push. It backs TrainFromReader so training a
+// corpus only ever keeps O(N) runes in memory, not the whole text.
+type slidingWindow struct {
+	buf   []rune
+	start int
+	n     int
+}
+
+func newSlidingWindow(size int) *slidingWindow {
+	return &slidingWindow{buf: make([]rune, size)}
+}
+
+func (w *slidingWindow) full() bool {
+	return w.n == len(w.buf)
+}
+
+// push appends r to the window, discarding the oldest rune once the
+// window is full.
+func (w *slidingWindow) push(r rune) {
+	size := len(w.buf)
+	if w.n < size {
+		w.buf[(w.start+w.n)%size] = r
+		w.n++
+		return
+	}
+	w.buf[w.start] = r
+	w.start = (w.start + 1) % size
+}
+
+// suffix returns the last k runes currently held, oldest first.
+func (w *slidingWindow) suffix(k int) string {
+	if k > w.n {
+		k = w.n
+	}
+	out := make([]rune, k)
+	for i := 0; i < k; i++ {
+		out[i] = w.buf[(w.start+w.n-k+i)%len(w.buf)]
+	}
+	return string(out)
+}
+
+// TrainFromReader trains the model by streaming r one rune at a time,
+// keeping only a sliding window of the last N runes instead of
+// materializing the whole corpus. Train and TrainFromFile both delegate
+// here so every ingestion path shares the same bounded-memory behavior.
+func (m *MarkovSeedGenerator) TrainFromReader(r io.Reader) error {
+	if len(m.Models) != m.N+1 {
+		m.Models = newOrderModels(m.N)
+		m.Model = m.Models[m.N]
+	}
+
+	br := bufio.NewReader(r)
+	window := newSlidingWindow(m.N)
+	trained := 0
+
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading training stream: %w", err)
+		}
+		if !isSanitizeableRune(c) {
+			continue
+		}
+
+		if window.full() {
+			nextChar := c
+			// Populate every order from 1 up to N in the same pass, so
+			// Generate can back off to a shorter context without a second
+			// training pass.
+			for order := 1; order <= m.N; order++ {
+				key := window.suffix(order)
+				table := m.Models[order]
+				stats, ok := table[key]
+				if !ok {
+					stats = newNgramStats()
+					table[key] = stats
+				}
+				stats.observe(nextChar)
+			}
+			trained++
+		}
+
+		window.push(c)
+	}
+
+	if trained == 0 {
+		return fmt.Errorf("training stream must contain more than n %d runes", m.N)
+	}
+
+	m.buildGlobalStats()
+	m.log("Trained model with %d n-grams", len(m.Model))
+	return nil
+}
+
+// Trainer is an io.WriteCloser that feeds arbitrary streams (HTTP bodies,
+// gzip readers, tar entries, ...) into a model incrementally via
+// TrainFromReader, without the caller needing to buffer the full input.
+type Trainer struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// NewTrainer returns a Trainer that trains m from whatever is written to
+// it. Callers must call Close when done to flush training and learn of
+// any error.
+func NewTrainer(m *MarkovSeedGenerator) *Trainer {
+	pr, pw := io.Pipe()
+	t := &Trainer{pw: pw, done: make(chan error, 1)}
+
+	go func() {
+		err := m.TrainFromReader(pr)
+		pr.CloseWithError(err)
+		t.done <- err
+	}()
+
+	return t
+}
+
+func (t *Trainer) Write(p []byte) (int, error) {
+	return t.pw.Write(p)
+}
+
+// Close signals end of input and waits for training to finish, returning
+// any training error.
+func (t *Trainer) Close() error {
+	if err := t.pw.Close(); err != nil {
+		return err
+	}
+	return <-t.done
+}